@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Check probes a single address and reports whether it is reachable.
+type Check interface {
+	// Name identifies the check, e.g. "icmp" or "tcp", so the result can
+	// record which one succeeded.
+	Name() string
+	// Probe tests addr and returns whether it responded, how long the
+	// response took, and any error encountered while probing (as opposed
+	// to a clean, non-error "down").
+	Probe(ctx context.Context, addr string) (ok bool, rtt time.Duration, err error)
+}
+
+// parseChecks builds the ordered list of Checks named in spec, a
+// comma-separated list such as "icmp,tcp". Checks are tried in the order
+// given and OR'd together: the first one to succeed wins.
+func parseChecks(spec string, timeout time.Duration, tcpPorts []int) ([]Check, error) {
+	var checks []Check
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "icmp":
+			checks = append(checks, icmpCheck{timeout: timeout})
+		case "tcp":
+			if len(tcpPorts) == 0 {
+				return nil, fmt.Errorf("-check tcp requires at least one port via -tcp")
+			}
+			checks = append(checks, tcpCheck{ports: tcpPorts, timeout: timeout})
+		case "http":
+			checks = append(checks, httpCheck{timeout: timeout})
+		case "arp-only":
+			checks = append(checks, arpOnlyCheck{})
+		default:
+			return nil, fmt.Errorf("unknown check %q (want icmp, tcp, http, or arp-only)", name)
+		}
+	}
+	return checks, nil
+}
+
+// parseTCPPorts parses a comma-separated port list such as "22,443".
+func parseTCPPorts(spec string) ([]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var ports []int
+	for _, s := range strings.Split(spec, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TCP port %q: %w", s, err)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// icmpCheck pings addr once and succeeds when no packet loss occurs.
+type icmpCheck struct {
+	timeout time.Duration
+}
+
+func (c icmpCheck) Name() string { return "icmp" }
+
+func (c icmpCheck) Probe(ctx context.Context, addr string) (bool, time.Duration, error) {
+	if ctx.Err() != nil {
+		return false, 0, ctx.Err()
+	}
+
+	pinger, err := ping.NewPinger(addr)
+	if err != nil {
+		return false, 0, err
+	}
+
+	pinger.SetPrivileged(true)
+	pinger.Timeout = c.timeout
+	pinger.Count = 1
+
+	if err := pinger.Run(); err != nil {
+		return false, 0, err
+	}
+
+	stats := pinger.Statistics()
+	return stats.PacketLoss == 0, stats.AvgRtt, nil
+}
+
+// tcpCheck succeeds if a TCP connection can be established to any one of
+// ports on addr within the timeout.
+type tcpCheck struct {
+	ports   []int
+	timeout time.Duration
+}
+
+func (c tcpCheck) Name() string { return "tcp" }
+
+func (c tcpCheck) Probe(ctx context.Context, addr string) (bool, time.Duration, error) {
+	for _, port := range c.ports {
+		if ctx.Err() != nil {
+			return false, 0, ctx.Err()
+		}
+
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(port)), c.timeout)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		return true, time.Since(start), nil
+	}
+	return false, 0, nil
+}
+
+// httpCheck succeeds if a GET to "/" on addr returns any non-5xx status.
+type httpCheck struct {
+	timeout time.Duration
+}
+
+func (c httpCheck) Name() string { return "http" }
+
+func (c httpCheck) Probe(ctx context.Context, addr string) (bool, time.Duration, error) {
+	client := &http.Client{Timeout: c.timeout}
+
+	url := fmt.Sprintf("http://%s/", addr)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, 0, nil
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode < 500, time.Since(start), nil
+}
+
+// arpOnlyCheck accepts every address without probing it; the presence of an
+// ARP entry is treated as sufficient evidence the host is alive.
+type arpOnlyCheck struct{}
+
+func (c arpOnlyCheck) Name() string { return "arp-only" }
+
+func (c arpOnlyCheck) Probe(ctx context.Context, addr string) (bool, time.Duration, error) {
+	return true, 0, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+)
+
+// keyringService is the service name credentials are stored under in the OS
+// keyring.
+const keyringService = "pan-pingable-hosts"
+
+// hostConfig is a single host's entry in the -config file.
+type hostConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// loadConfig reads a YAML file mapping firewall hostnames to per-host
+// credentials, e.g.:
+//
+//	fw01.corp.com:
+//	  user: admin
+//	  password: hunter2
+//
+// A missing path (including the default) is not an error; it simply yields
+// no per-host overrides.
+func loadConfig(path string) (map[string]hostConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	var cfg map[string]hostConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// defaultConfigPath returns ~/.pan-pingable.yaml, or "" if the home
+// directory can't be determined.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home + "/.pan-pingable.yaml"
+}
+
+// keyringKey is the account name a host+user's password is stored under.
+func keyringKey(host, user string) string {
+	return fmt.Sprintf("%s@%s", user, host)
+}
+
+// savePassword best-effort caches password in the OS keyring so it isn't
+// re-entered on the next run. Failures are non-fatal: not every environment
+// has a usable keyring backend.
+func savePassword(host, user, password string) {
+	if err := keyring.Set(keyringService, keyringKey(host, user), password); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not save password to keyring: %v\n", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Dapacruz/pan-pingable-hosts/panapi"
+)
+
+// arpFilter selects which ARP entries are worth probing. A zero-value
+// arpFilter matches everything.
+type arpFilter struct {
+	ifaces   map[string]bool
+	vsys     string
+	statuses map[string]bool
+	minTTL   int
+	includes []*net.IPNet
+	excludes []*net.IPNet
+}
+
+// newArpFilter builds an arpFilter from comma-separated flag values. Any
+// empty spec leaves that dimension unfiltered.
+func newArpFilter(ifaceSpec, vsys, statusSpec string, minTTL int, includeSpec, excludeSpec string) (*arpFilter, error) {
+	f := &arpFilter{vsys: vsys, minTTL: minTTL}
+
+	if ifaceSpec != "" {
+		f.ifaces = make(map[string]bool)
+		for _, iface := range strings.Split(ifaceSpec, ",") {
+			f.ifaces[strings.TrimSpace(iface)] = true
+		}
+	}
+
+	if statusSpec != "" {
+		f.statuses = make(map[string]bool)
+		for _, status := range strings.Split(statusSpec, ",") {
+			f.statuses[strings.ToLower(strings.TrimSpace(status))] = true
+		}
+	}
+
+	var err error
+	if f.includes, err = parseCIDRs(includeSpec); err != nil {
+		return nil, err
+	}
+	if f.excludes, err = parseCIDRs(excludeSpec); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func parseCIDRs(spec string) ([]*net.IPNet, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(spec, ",") {
+		_, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// match reports whether e passes every configured dimension of the filter.
+func (f *arpFilter) match(e panapi.Entry) bool {
+	if f.ifaces != nil && !f.ifaces[e.Interface] {
+		return false
+	}
+	if f.vsys != "" && e.Vsys != f.vsys {
+		return false
+	}
+	if f.statuses != nil && !f.statuses[strings.ToLower(e.Status)] {
+		return false
+	}
+	if f.minTTL > 0 && e.Ttl < f.minTTL {
+		return false
+	}
+
+	if len(f.includes) > 0 || len(f.excludes) > 0 {
+		ip := net.ParseIP(e.IP)
+		if ip == nil {
+			return false
+		}
+		if len(f.includes) > 0 && !anyContains(f.includes, ip) {
+			return false
+		}
+		if anyContains(f.excludes, ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func anyContains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
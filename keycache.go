@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keyCachePath returns the path PAN-OS API keys are cached under, creating
+// its parent directory if necessary.
+func keyCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".config", "pan-pingable-hosts")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "keys.json"), nil
+}
+
+// loadKeyCache reads the cached API keys, keyed by "user@host". A missing
+// file is not an error; it simply yields an empty cache.
+func loadKeyCache() (map[string]string, error) {
+	path, err := keyCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("reading key cache %s: %w", path, err)
+	}
+
+	cache := map[string]string{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("parsing key cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// saveKeyCache writes cache to disk, mode 0600.
+func saveKeyCache(cache map[string]string) error {
+	path, err := keyCachePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// removeCachedKeys deletes the cached key for user@host. If user is empty,
+// every cached key for host (any user) is deleted.
+func removeCachedKeys(cache map[string]string, host, user string) {
+	if user != "" {
+		delete(cache, keyringKey(host, user))
+		return
+	}
+	for k := range cache {
+		if strings.HasSuffix(k, "@"+host) {
+			delete(cache, k)
+		}
+	}
+}
+
+// buildTLSConfig returns the TLS configuration used to connect to PAN-OS
+// devices. A pinned CA certificate takes precedence over -insecure, since a
+// caller who supplied one clearly wants verification.
+func buildTLSConfig(insecure bool, caCertPath string) (*tls.Config, error) {
+	if caCertPath != "" {
+		pem, err := os.ReadFile(caCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate %s: %w", caCertPath, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCertPath)
+		}
+		return &tls.Config{RootCAs: pool}, nil
+	}
+	if insecure {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	return &tls.Config{}, nil
+}
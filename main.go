@@ -3,23 +3,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"encoding/base64"
-	"encoding/xml"
 	"flag"
 	"fmt"
-	"io"
-	"log"
 	"net"
-	"net/http"
 	"os"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/Dapacruz/pan-pingable-hosts/panapi"
 	"github.com/fatih/color"
-	"github.com/go-ping/ping"
+	"github.com/zalando/go-keyring"
 	"golang.org/x/term"
 )
 
@@ -29,99 +28,207 @@ var (
 	red   = color.New(color.FgRed)
 )
 
-type ArpCache struct {
-	Entries []Interface `xml:"result>entries>entry"`
+// arpAddr is an address harvested from the ARP cache, along with the MAC it
+// was seen with.
+type arpAddr struct {
+	addr string
+	mac  string
 }
 
-type Interface struct {
-	Name    string `xml:"interface"`
-	Address string `xml:"ip"`
+// devIface identifies an interface on a specific device. Per-interface
+// "stop after N pingable" quotas are tracked per devIface so they stay
+// independent across devices sharing an interface name, without smuggling
+// the device name into the interface reported to callers.
+type devIface struct {
+	device string
+	iface  string
+}
+
+// pingJob is a single address queued for probing, tagged with the
+// device/interface it was harvested from so workers can honor per-interface
+// limits.
+type pingJob struct {
+	key  devIface
+	addr arpAddr
+}
+
+// pingResult is the outcome of probing a single pingJob.
+type pingResult struct {
+	key   devIface
+	addr  arpAddr
+	ok    bool
+	check string
+	rtt   time.Duration
+	err   error
 }
 
 func main() {
-	var firewall string
 	var user string
 	var numAddresses int
 	var timeout int
-	var password string
+	var concurrency int
+	var checkSpec string
+	var tcpPortsSpec string
+	var outputFormat string
+	var hostsFile string
+	var panorama bool
+	var configPath string
+	var insecure bool
+	var caCertPath string
+	var logout bool
+	var ifaceSpec string
+	var vsys string
+	var includeSpec string
+	var excludeSpec string
+	var minTTL int
+	var statusSpec string
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Harvests pingable IP addresses from a Palo Alto Networks firewall ARP cache\n\n")
-		fmt.Fprintf(os.Stderr, "USAGE: pan-pingable-hosts [options] <firewall>\n\n")
+		fmt.Fprintf(os.Stderr, "Harvests pingable IP addresses from one or more Palo Alto Networks firewall ARP caches\n\n")
+		fmt.Fprintf(os.Stderr, "USAGE: pan-pingable-hosts [options] <firewall> [firewall ...]\n\n")
 		fmt.Fprintf(os.Stderr, "EXAMPLES:\n")
 		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts fw01.domain.com\n")
-		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user panwfw01.corp.com\n")
-		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -n 4 panwfw01.corp.com\n\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user panwfw01.corp.com panwfw02.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -n 4 panwfw01.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -c 64 panwfw01.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -check tcp -tcp 22,443 panwfw01.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -o json panwfw01.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -f hosts.txt\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -panorama panorama01.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -logout panwfw01.corp.com\n")
+		fmt.Fprintf(os.Stderr, "  > pan-pingable-hosts -u user -iface eth1/1 -status c -min-ttl 60 panwfw01.corp.com\n\n")
 		fmt.Fprintf(os.Stderr, "OPTIONS:\n")
 		flag.PrintDefaults()
 	}
 	flag.StringVar(&user, "u", "", "PAN user")
 	flag.IntVar(&numAddresses, "n", 2, "Number of addresses per interface")
 	flag.IntVar(&timeout, "t", 250, "ICMP timeout in milliseconds")
+	flag.IntVar(&concurrency, "c", 32, "Number of addresses to ping concurrently")
+	flag.IntVar(&concurrency, "concurrency", 32, "Number of addresses to ping concurrently")
+	flag.StringVar(&checkSpec, "check", "icmp", "Comma-separated checks to try, in order (icmp, tcp, http, arp-only)")
+	flag.StringVar(&tcpPortsSpec, "tcp", "", "Comma-separated TCP ports to dial for the tcp check, e.g. 22,443")
+	flag.StringVar(&outputFormat, "o", "text", "Output format: text, json, ndjson, csv, or prom")
+	flag.StringVar(&hostsFile, "f", "", "File of firewall hostnames to scan, one per line")
+	flag.BoolVar(&panorama, "panorama", false, "Treat the single firewall argument as a Panorama and fan out to its managed firewalls")
+	flag.StringVar(&configPath, "config", "", "YAML file of per-host credentials (default ~/.pan-pingable.yaml)")
+	flag.BoolVar(&insecure, "insecure", false, "Skip TLS certificate verification (discouraged)")
+	flag.StringVar(&caCertPath, "ca-cert", "", "PEM file of the CA certificate to verify the firewall against")
+	flag.BoolVar(&logout, "logout", false, "Invalidate cached API keys for the given firewalls and exit")
+	flag.StringVar(&ifaceSpec, "iface", "", "Comma-separated interfaces to limit scanning to, e.g. eth1/1,eth1/2")
+	flag.StringVar(&vsys, "vsys", "", "Limit scanning to ARP entries in this vsys")
+	flag.StringVar(&includeSpec, "include", "", "Comma-separated CIDRs to limit scanning to")
+	flag.StringVar(&excludeSpec, "exclude", "", "Comma-separated CIDRs to exclude from scanning")
+	flag.IntVar(&minTTL, "min-ttl", 0, "Minimum ARP entry TTL, in seconds, required to scan an address")
+	flag.StringVar(&statusSpec, "status", "", "Comma-separated ARP entry statuses to limit scanning to, e.g. s,c")
 	flag.Parse()
 
-	// Ensure the target firewall is defined, otherwise exit and display usage
-	if flag.NArg() != 1 {
+	firewalls, err := resolveFirewalls(flag.Args(), hostsFile)
+	if err != nil {
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
+	}
+	if len(firewalls) == 0 {
 		flag.Usage()
 		os.Exit(1)
-	} else {
-		firewall = flag.Arg(0)
 	}
-
-	fmt.Fprintln(os.Stderr)
-	if user == "" {
-		fmt.Fprint(os.Stderr, "PAN User: ")
-		fmt.Scanln(&user)
+	if panorama && len(firewalls) != 1 {
+		red.Fprintf(os.Stderr, "-panorama takes exactly one firewall argument\n\n")
+		os.Exit(1)
 	}
 
-	fmt.Fprintf(os.Stderr, "Password (%s): ", user)
-	bytepw, err := term.ReadPassword(int(syscall.Stdin))
+	if configPath == "" {
+		configPath = defaultConfigPath()
+	}
+	hostConfigs, err := loadConfig(configPath)
 	if err != nil {
-		panic(err)
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
 	}
-	password = string(bytepw)
-	fmt.Fprintf(os.Stderr, "\n\n")
 
-	start := time.Now()
-	fmt.Fprintf(os.Stderr, "Downloading ARP cache from %v ... ", firewall)
-	data := getArpCache(firewall, user, password)
-	var arpCache ArpCache
-	err = xml.Unmarshal([]byte(data), &arpCache)
+	if logout {
+		keyCache, err := loadKeyCache()
+		if err != nil {
+			red.Fprintf(os.Stderr, "%v\n\n", err)
+			os.Exit(1)
+		}
+		for _, host := range firewalls {
+			logoutUser := user
+			if hc, ok := hostConfigs[host]; ok && hc.User != "" {
+				logoutUser = hc.User
+			}
+			removeCachedKeys(keyCache, host, logoutUser)
+		}
+		if err := saveKeyCache(keyCache); err != nil {
+			red.Fprintf(os.Stderr, "%v\n\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Invalidated cached API keys for %d firewall(s)\n", len(firewalls))
+		os.Exit(0)
+	}
+
+	tlsConfig, err := buildTLSConfig(insecure, caCertPath)
 	if err != nil {
-		red.Fprintf(os.Stderr, "fail\n\n")
-		panic(err)
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
 	}
-	green.Fprintf(os.Stderr, "success\n")
 
-	fmt.Fprintf(os.Stderr, "Parsing ARP cache ... ")
-	// Create a map of interfaces with a slice of addresses
-	interfaces := make(map[string][]string)
-	for _, int := range arpCache.Entries {
-		interfaces[int.Name] = append(interfaces[int.Name], int.Address)
+	filter, err := newArpFilter(ifaceSpec, vsys, statusSpec, minTTL, includeSpec, excludeSpec)
+	if err != nil {
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
 	}
-	green.Fprintf(os.Stderr, "success\n")
 
-	fmt.Fprintf(os.Stderr, "Pinging IP addresses ... ")
-	// Harvest pingable addresses from each interface
-	var pingableHosts []string
-	for _, addrs := range interfaces {
-		pingableHosts = append(pingableHosts, getPingableAddresses(addrs, numAddresses, timeout)...)
+	// buildClient already resolves credentials per-host, via PANOS_API_KEY,
+	// a cached API key, -config, the OS keyring, or (as a last resort) an
+	// interactive prompt. Only prompt here, up front, when PANOS_API_KEY
+	// isn't set; otherwise the env var is rendered useless and a
+	// non-interactive stdin (cron, CI) would crash the unconditional
+	// ReadPassword below.
+	var password string
+	if os.Getenv("PANOS_API_KEY") == "" {
+		fmt.Fprintln(os.Stderr)
+		if user == "" {
+			fmt.Fprint(os.Stderr, "PAN User: ")
+			fmt.Scanln(&user)
+		}
+
+		fmt.Fprintf(os.Stderr, "Password (%s): ", user)
+		bytepw, err := term.ReadPassword(int(syscall.Stdin))
+		if err != nil {
+			panic(err)
+		}
+		password = string(bytepw)
+		fmt.Fprintf(os.Stderr, "\n\n")
 	}
-	green.Fprintf(os.Stderr, "success\n\n")
 
-	// Sort the pingableHosts slice
-	pingableHostsSorted := make([]net.IP, 0, len(pingableHosts))
-	for _, ip := range pingableHosts {
-		pingableHostsSorted = append(pingableHostsSorted, net.ParseIP(ip))
+	start := time.Now()
+	interfaces, arpEntriesTotal := harvestArpCaches(firewalls, panorama, user, password, hostConfigs, tlsConfig, filter)
+
+	tcpPorts, err := parseTCPPorts(tcpPortsSpec)
+	if err != nil {
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
+	}
+	checks, err := parseChecks(checkSpec, time.Duration(timeout)*time.Millisecond, tcpPorts)
+	if err != nil {
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
 	}
-	sort.Slice(pingableHostsSorted, func(i int, j int) bool {
-		return bytes.Compare(pingableHostsSorted[i], pingableHostsSorted[j]) < 0
+
+	// Harvest pingable addresses across all interfaces concurrently
+	pingableHosts := getPingableAddresses(interfaces, numAddresses, checks, concurrency)
+	fmt.Fprintln(os.Stderr)
+
+	// Sort the records by IP
+	sort.Slice(pingableHosts, func(i int, j int) bool {
+		return bytes.Compare(net.ParseIP(pingableHosts[i].IP), net.ParseIP(pingableHosts[j].IP)) < 0
 	})
 
 	// Print results
-	for _, addr := range pingableHostsSorted {
-		fmt.Println(addr)
+	if err := writeOutput(os.Stdout, outputFormat, pingableHosts, arpEntriesTotal); err != nil {
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
 	}
 	fmt.Fprintln(os.Stderr)
 
@@ -130,91 +237,360 @@ func main() {
 	fmt.Fprintf(os.Stderr, " Collection complete: Discovered %d pingable addresses in %.3f seconds\n", len(pingableHosts), elapsed.Seconds())
 }
 
-func getPingableAddresses(addrs []string, numAddrs int, timeout int) []string {
-	var pingableAddrs []string
+// getPingableAddresses fans candidate addresses from every interface out
+// across a bounded worker pool, pinging them concurrently with a shared
+// timeout. It honors the "stop after numAddrs pingable" rule per interface by
+// cancelling that interface's context once its quota is met, so in-flight and
+// queued workers skip the remainder of its addresses. Progress is streamed to
+// stderr as the pool drains.
+func getPingableAddresses(interfaces map[devIface][]arpAddr, numAddrs int, checks []Check, concurrency int) []hostRecord {
+	var jobs []pingJob
+	ifaceCtx := make(map[devIface]context.Context)
+	ifaceCancel := make(map[devIface]context.CancelFunc)
+	for key, addrs := range interfaces {
+		ctx, cancel := context.WithCancel(context.Background())
+		ifaceCtx[key] = ctx
+		ifaceCancel[key] = cancel
+		for _, addr := range addrs {
+			// If ip addr begins with 0 skip iteration
+			if strings.HasPrefix(addr.addr, "0") {
+				continue
+			}
+			jobs = append(jobs, pingJob{key: key, addr: addr})
+		}
+	}
+	total := len(jobs)
+
+	jobsCh := make(chan pingJob)
+	resultsCh := make(chan pingResult)
+
+	var wg sync.WaitGroup
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobsCh {
+				ctx := ifaceCtx[job.key]
+				if ctx.Err() != nil {
+					resultsCh <- pingResult{key: job.key, addr: job.addr, ok: false}
+					continue
+				}
+
+				ok, rtt, checkName, err := probe(ctx, job.addr.addr, checks)
+				resultsCh <- pingResult{key: job.key, addr: job.addr, ok: ok, rtt: rtt, check: checkName, err: err}
+			}
+		}()
+	}
 
-	for _, addr := range addrs {
-		// If ip addr begins with 0 skip iteration
-		if strings.HasPrefix(addr, "0") {
+	go func() {
+		for _, job := range jobs {
+			jobsCh <- job
+		}
+		close(jobsCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultsCh)
+	}()
+
+	var mu sync.Mutex
+	counts := make(map[devIface]int)
+	var pingableHosts []hostRecord
+	var done int32
+
+	stopProgress := make(chan struct{})
+	go reportProgress(&done, total, stopProgress)
+
+	var probeErrCount int32
+	var probeErrOnce sync.Once
+	var firstProbeErr error
+
+	for res := range resultsCh {
+		atomic.AddInt32(&done, 1)
+		if res.err != nil {
+			atomic.AddInt32(&probeErrCount, 1)
+			probeErrOnce.Do(func() { firstProbeErr = res.err })
+		}
+		if !res.ok {
 			continue
 		}
 
-		// Ping ip addr and add to pingableAddrs if a response is received
-		stats := pingAddr(addr, timeout)
-		if stats.PacketLoss == 0 {
-			pingableAddrs = append(pingableAddrs, addr)
+		mu.Lock()
+		counts[res.key]++
+		if counts[res.key] <= numAddrs {
+			rttSec := res.rtt.Seconds()
+			pingableHosts = append(pingableHosts, hostRecord{
+				IP:        res.addr.addr,
+				Device:    res.key.device,
+				Interface: res.key.iface,
+				MAC:       res.addr.mac,
+				Check:     res.check,
+				RTTMinSec: rttSec,
+				RTTAvgSec: rttSec,
+				RTTMaxSec: rttSec,
+				Timestamp: time.Now(),
+			})
+		}
+		if counts[res.key] >= numAddrs {
+			ifaceCancel[res.key]()
 		}
+		mu.Unlock()
+	}
+	close(stopProgress)
+
+	if n := atomic.LoadInt32(&probeErrCount); n > 0 {
+		red.Fprintf(os.Stderr, "warning: %d probe(s) failed with an error (first: %v)\n", n, firstProbeErr)
+	}
 
-		// skip remaining addrs if pingableAddrs is eqaul to numAddrs
-		if len(pingableAddrs) == numAddrs {
-			break
+	return pingableHosts
+}
+
+// reportProgress prints a live "done/total (ETA)" indicator to stderr until
+// stop is closed.
+func reportProgress(done *int32, total int, stop <-chan struct{}) {
+	if total == 0 {
+		return
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	print := func() {
+		d := atomic.LoadInt32(done)
+		elapsed := time.Since(start)
+		var eta time.Duration
+		if d > 0 {
+			eta = time.Duration(float64(elapsed) / float64(d) * float64(total-int(d)))
 		}
+		fmt.Fprintf(os.Stderr, "\rPinging IP addresses ... %d/%d (ETA %s)   ", d, total, eta.Round(time.Millisecond))
 	}
 
-	return pingableAddrs
+	for {
+		select {
+		case <-stop:
+			print()
+			fmt.Fprintln(os.Stderr)
+			return
+		case <-ticker.C:
+			print()
+		}
+	}
 }
 
-func pingAddr(addr string, timeout int) *ping.Statistics {
-	// ping ip addr
+// probe tries each check against addr in order and returns on the first
+// success, reporting which check succeeded (OR semantics). If every check
+// fails, the last error encountered (if any) is returned so callers can
+// distinguish "no host there" from "the check itself is broken".
+func probe(ctx context.Context, addr string, checks []Check) (ok bool, rtt time.Duration, checkName string, err error) {
+	for _, check := range checks {
+		if ctx.Err() != nil {
+			return false, 0, "", ctx.Err()
+		}
 
-	pinger, err := ping.NewPinger(addr)
-	if err != nil {
-		panic(err)
+		checkOK, checkRTT, checkErr := check.Probe(ctx, addr)
+		if checkErr != nil {
+			err = checkErr
+			continue
+		}
+		if !checkOK {
+			continue
+		}
+		return true, checkRTT, check.Name(), nil
 	}
+	return false, 0, "", err
+}
 
-	pinger.SetPrivileged(true)
-	pinger.Timeout = time.Duration((time.Duration(timeout) * time.Millisecond))
-	pinger.Count = 1
+// resolveFirewalls merges the positional firewall arguments with the
+// contents of hostsFile (one hostname per line, blank lines and "#"
+// comments ignored), preserving order and dropping duplicates.
+func resolveFirewalls(args []string, hostsFile string) ([]string, error) {
+	var firewalls []string
+	seen := make(map[string]bool)
 
-	err = pinger.Run()
-	if err != nil {
-		log.Fatalf("ICMP socket operations require 'sudo'\n")
+	add := func(host string) {
+		if host == "" || seen[host] {
+			return
+		}
+		seen[host] = true
+		firewalls = append(firewalls, host)
+	}
+
+	for _, host := range args {
+		add(host)
 	}
 
-	stats := pinger.Statistics()
+	if hostsFile != "" {
+		data, err := os.ReadFile(hostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading hosts file %s: %w", hostsFile, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			add(line)
+		}
+	}
 
-	return stats
+	return firewalls, nil
 }
 
-func getArpCache(fw string, user string, pw string) string {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// buildClient resolves credentials for host and returns a panapi.Client
+// authenticated with a PAN-OS API key. Precedence, highest first: the
+// PANOS_API_KEY environment variable, a cached key from a prior run, and
+// finally a fresh Keygen() call using credentials from the host's entry in
+// the -config file, the OS keyring, or the interactively-prompted
+// defaultUser/defaultPassword. A freshly generated key is written into
+// keyCache (the caller persists it).
+func buildClient(ctx context.Context, host, defaultUser, defaultPassword string, hostConfigs map[string]hostConfig, tlsConfig *tls.Config, keyCache map[string]string) (*panapi.Client, error) {
+	if apiKey := os.Getenv("PANOS_API_KEY"); apiKey != "" {
+		return panapi.NewAPIKeyClient(host, apiKey, tlsConfig), nil
 	}
-	client := &http.Client{Transport: tr}
 
-	url := fmt.Sprintf("https://%s/api/", fw)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		red.Fprintf(os.Stderr, "fail\n\n")
-		panic(err)
+	user, password := defaultUser, defaultPassword
+	if hc, ok := hostConfigs[host]; ok {
+		if hc.User != "" {
+			user = hc.User
+		}
+		if hc.Password != "" {
+			password = hc.Password
+		}
 	}
 
-	creds := fmt.Sprintf("%s:%s", user, pw)
-	credsEnc := base64.StdEncoding.EncodeToString([]byte(creds))
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", credsEnc))
+	if key, ok := keyCache[keyringKey(host, user)]; ok {
+		return panapi.NewAPIKeyClient(host, key, tlsConfig), nil
+	}
 
-	q := req.URL.Query()
-	q.Add("type", "op")
-	q.Add("cmd", "<show><arp><entry name = 'all'/></arp></show>")
-	req.URL.RawQuery = q.Encode()
+	if password == "" {
+		if stored, err := keyring.Get(keyringService, keyringKey(host, user)); err == nil {
+			password = stored
+		}
+	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		red.Fprintf(os.Stderr, "fail\n\n")
-		panic(err)
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "Password (%s@%s): ", user, host)
+		bytepw, err := term.ReadPassword(int(syscall.Stdin))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			panic(err)
+		}
+		password = string(bytepw)
+		savePassword(host, user, password)
 	}
-	if resp.StatusCode != 200 {
-		red.Fprintf(os.Stderr, "fail\n\n")
-		log.Fatal(resp.Status)
+
+	key, err := panapi.NewClient(host, user, password, tlsConfig).Keygen(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("generating API key for %s: %w", host, err)
 	}
+	keyCache[keyringKey(host, user)] = key
 
-	defer resp.Body.Close()
+	return panapi.NewAPIKeyClient(host, key, tlsConfig), nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+// harvestArpCaches downloads the ARP cache from every firewall (or, if
+// panorama is set, from every firewall managed by the single firewall
+// given), isolating per-device failures so one unreachable device doesn't
+// abort the run. Results are merged into a single map of devIface (device +
+// interface name) to addresses, so per-interface limits stay independent
+// across devices. It also returns the total number of ARP entries seen
+// (before filter is applied), for the prom output format. filter selects
+// which of those entries are kept for probing.
+func harvestArpCaches(firewalls []string, panorama bool, defaultUser, defaultPassword string, hostConfigs map[string]hostConfig, tlsConfig *tls.Config, filter *arpFilter) (map[devIface][]arpAddr, int) {
+	ctx := context.Background()
+	interfaces := make(map[devIface][]arpAddr)
+	arpEntriesTotal := 0
+
+	keyCache, err := loadKeyCache()
 	if err != nil {
-		red.Fprintf(os.Stderr, "fail\n\n")
-		panic(err)
+		red.Fprintf(os.Stderr, "%v\n\n", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := saveKeyCache(keyCache); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not save API key cache: %v\n", err)
+		}
+	}()
+
+	merge := func(device string, entries []panapi.Entry) {
+		arpEntriesTotal += len(entries)
+		for _, e := range entries {
+			if !filter.match(e) {
+				continue
+			}
+			key := devIface{device: device, iface: e.Interface}
+			interfaces[key] = append(interfaces[key], arpAddr{addr: e.IP, mac: e.Mac})
+		}
 	}
 
-	return string(respBody)
+	if panorama {
+		host := firewalls[0]
+		fmt.Fprintf(os.Stderr, "Downloading device list from %v ... ", host)
+		client, err := buildClient(ctx, host, defaultUser, defaultPassword, hostConfigs, tlsConfig, keyCache)
+		if err != nil {
+			red.Fprintf(os.Stderr, "fail: %v\n\n", err)
+			os.Exit(1)
+		}
+		devices, err := client.GetConnectedDevices(ctx)
+		if err != nil {
+			red.Fprintf(os.Stderr, "fail: %v\n\n", err)
+			os.Exit(1)
+		}
+		green.Fprintf(os.Stderr, "success\n\n")
+
+		for _, d := range devices.Devices {
+			fmt.Fprintf(os.Stderr, "Downloading ARP cache from %v (%v) ... ", d.Hostname, d.Serial)
+			arpCache, err := client.GetArpCache(ctx, d.Serial)
+			if err != nil {
+				red.Fprintf(os.Stderr, "fail: %v\n", err)
+				continue
+			}
+			green.Fprintf(os.Stderr, "success\n")
+			merge(d.Hostname, arpCache.Entries)
+		}
+		fmt.Fprintln(os.Stderr)
+		return interfaces, arpEntriesTotal
+	}
+
+	// Resolve credentials (which may mean prompting interactively, or
+	// calling Keygen) for every host up front and serially, before fanning
+	// out, so prompts never interleave.
+	clients := make(map[string]*panapi.Client, len(firewalls))
+	for _, host := range firewalls {
+		client, err := buildClient(ctx, host, defaultUser, defaultPassword, hostConfigs, tlsConfig, keyCache)
+		if err != nil {
+			red.Fprintf(os.Stderr, "%v\n", err)
+			continue
+		}
+		clients[host] = client
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for host, client := range clients {
+		wg.Add(1)
+		go func(host string, client *panapi.Client) {
+			defer wg.Done()
+			fmt.Fprintf(os.Stderr, "Downloading ARP cache from %v ... ", host)
+			arpCache, err := client.GetArpCache(ctx, "")
+			if err != nil {
+				red.Fprintf(os.Stderr, "fail: %v\n", err)
+				return
+			}
+			green.Fprintf(os.Stderr, "success\n")
+
+			mu.Lock()
+			merge(host, arpCache.Entries)
+			mu.Unlock()
+		}(host, client)
+	}
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+
+	return interfaces, arpEntriesTotal
 }
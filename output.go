@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// hostRecord is a single host's probe result, used by every output format
+// except "text".
+type hostRecord struct {
+	IP        string    `json:"ip"`
+	Device    string    `json:"device"`
+	Interface string    `json:"interface"`
+	MAC       string    `json:"mac"`
+	Check     string    `json:"check"`
+	RTTMinSec float64   `json:"rtt_min_seconds"`
+	RTTAvgSec float64   `json:"rtt_avg_seconds"`
+	RTTMaxSec float64   `json:"rtt_max_seconds"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// writeOutput renders records, sorted by IP, to w in the requested format.
+// arpEntriesTotal is only used by the prom format.
+func writeOutput(w io.Writer, format string, records []hostRecord, arpEntriesTotal int) error {
+	switch format {
+	case "text", "":
+		for _, r := range records {
+			fmt.Fprintln(w, r.IP)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		return writeCSV(w, records)
+	case "prom":
+		return writeProm(w, records, arpEntriesTotal)
+	default:
+		return fmt.Errorf("unknown output format %q (want text, json, ndjson, csv, or prom)", format)
+	}
+}
+
+func writeCSV(w io.Writer, records []hostRecord) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	header := []string{"ip", "device", "interface", "mac", "check", "rtt_min_seconds", "rtt_avg_seconds", "rtt_max_seconds", "timestamp"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		row := []string{
+			r.IP,
+			r.Device,
+			r.Interface,
+			r.MAC,
+			r.Check,
+			strconv.FormatFloat(r.RTTMinSec, 'f', -1, 64),
+			strconv.FormatFloat(r.RTTAvgSec, 'f', -1, 64),
+			strconv.FormatFloat(r.RTTMaxSec, 'f', -1, 64),
+			r.Timestamp.Format(time.RFC3339),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProm renders records as gauges suitable for node_exporter's textfile
+// collector.
+func writeProm(w io.Writer, records []hostRecord, arpEntriesTotal int) error {
+	fmt.Fprintln(w, "# HELP pan_host_up Whether the host responded to a check (1) or not present")
+	fmt.Fprintln(w, "# TYPE pan_host_up gauge")
+	for _, r := range records {
+		fmt.Fprintf(w, "pan_host_up{ip=%q,device=%q,interface=%q,check=%q} 1\n", r.IP, r.Device, r.Interface, r.Check)
+	}
+
+	fmt.Fprintln(w, "# HELP pan_host_rtt_seconds Average round-trip time of the successful check")
+	fmt.Fprintln(w, "# TYPE pan_host_rtt_seconds gauge")
+	for _, r := range records {
+		fmt.Fprintf(w, "pan_host_rtt_seconds{ip=%q,device=%q,interface=%q,check=%q} %g\n", r.IP, r.Device, r.Interface, r.Check, r.RTTAvgSec)
+	}
+
+	fmt.Fprintln(w, "# HELP pan_arp_entries_total Number of entries in the firewall's ARP cache")
+	fmt.Fprintln(w, "# TYPE pan_arp_entries_total gauge")
+	fmt.Fprintf(w, "pan_arp_entries_total %d\n", arpEntriesTotal)
+
+	return nil
+}
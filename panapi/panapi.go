@@ -0,0 +1,208 @@
+// Package panapi is a minimal client for the PAN-OS XML API, used to pull
+// the ARP cache from a firewall or, via Panorama, from its managed
+// firewalls.
+package panapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	netURL "net/url"
+	"strings"
+)
+
+// ArpCache is the parsed result of <show><arp><entry name='all'/></arp></show>.
+type ArpCache struct {
+	Entries []Entry `xml:"result>entries>entry"`
+}
+
+// Entry is a single row of a firewall's ARP cache.
+type Entry struct {
+	Interface string `xml:"interface"`
+	IP        string `xml:"ip"`
+	Mac       string `xml:"mac"`
+	Vsys      string `xml:"vsys"`
+	Status    string `xml:"status"`
+	Ttl       int    `xml:"ttl"`
+	Port      string `xml:"port"`
+}
+
+// ConnectedDevices is the parsed result of
+// <show><devices><connected/></devices></show>, issued against a Panorama.
+type ConnectedDevices struct {
+	Devices []Device `xml:"result>devices>entry"`
+}
+
+// Device is a single firewall managed by a Panorama.
+type Device struct {
+	Serial    string `xml:"name,attr"`
+	Hostname  string `xml:"hostname"`
+	IPAddress string `xml:"ip-address"`
+	Connected string `xml:"connected"`
+}
+
+// Client talks to a single PAN-OS device's (firewall or Panorama) XML API.
+type Client struct {
+	Host       string
+	user       string
+	password   string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient returns a Client that authenticates to host with user and
+// password, for use with Keygen. tlsConfig controls certificate
+// verification; pass nil to use the system roots.
+func NewClient(host, user, password string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		Host:       host,
+		user:       user,
+		password:   password,
+		httpClient: newHTTPClient(tlsConfig),
+	}
+}
+
+// NewAPIKeyClient returns a Client that authenticates to host with an
+// already-issued PAN-OS API key, skipping user/password auth entirely.
+func NewAPIKeyClient(host, apiKey string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		Host:       host,
+		apiKey:     apiKey,
+		httpClient: newHTTPClient(tlsConfig),
+	}
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// Keygen exchanges the Client's user and password for a long-lived PAN-OS
+// API key via the type=keygen endpoint. The credentials are sent as a POST
+// body rather than URL query parameters, since query strings routinely end
+// up logged by proxies and webservers. The caller is responsible for
+// caching the result; Keygen itself does not cache.
+func (c *Client) Keygen(ctx context.Context) (string, error) {
+	url := fmt.Sprintf("https://%s/api/", c.Host)
+	form := netURL.Values{}
+	form.Set("type", "keygen")
+	form.Set("user", c.user)
+	form.Set("password", c.password)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting API key from %s: %w", c.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting API key from %s: %s", c.Host, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading keygen response from %s: %w", c.Host, err)
+	}
+
+	var keygen struct {
+		Key string `xml:"result>key"`
+	}
+	if err := xml.Unmarshal(body, &keygen); err != nil || keygen.Key == "" {
+		return "", fmt.Errorf("parsing keygen response from %s: %s", c.Host, body)
+	}
+	return keygen.Key, nil
+}
+
+// GetArpCache fetches and parses the ARP cache from the Client's host. If
+// target is non-empty, the request is proxied through a Panorama to the
+// managed firewall identified by that serial number.
+func (c *Client) GetArpCache(ctx context.Context, target string) (*ArpCache, error) {
+	q := map[string]string{
+		"type": "op",
+		"cmd":  "<show><arp><entry name = 'all'/></arp></show>",
+	}
+	if target != "" {
+		q["target"] = target
+	}
+
+	body, err := c.op(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var arpCache ArpCache
+	if err := xml.Unmarshal(body, &arpCache); err != nil {
+		return nil, fmt.Errorf("parsing ARP cache from %s: %w", c.Host, err)
+	}
+	return &arpCache, nil
+}
+
+// GetConnectedDevices fetches the firewalls a Panorama is managing.
+func (c *Client) GetConnectedDevices(ctx context.Context) (*ConnectedDevices, error) {
+	body, err := c.op(ctx, map[string]string{
+		"type": "op",
+		"cmd":  "<show><devices><connected/></devices></show>",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var devices ConnectedDevices
+	if err := xml.Unmarshal(body, &devices); err != nil {
+		return nil, fmt.Errorf("parsing connected devices from %s: %w", c.Host, err)
+	}
+	return &devices, nil
+}
+
+// op issues an XML API request with the given query parameters and returns
+// the raw response body.
+func (c *Client) op(ctx context.Context, params map[string]string) ([]byte, error) {
+	url := fmt.Sprintf("https://%s/api/", c.Host)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	for k, v := range params {
+		q.Add(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	if c.apiKey != "" {
+		req.Header.Set("X-PAN-KEY", c.apiKey)
+	} else {
+		creds := fmt.Sprintf("%s:%s", c.user, c.password)
+		credsEnc := base64.StdEncoding.EncodeToString([]byte(creds))
+		req.Header.Set("Authorization", fmt.Sprintf("Basic %s", credsEnc))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", c.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("querying %s: %s", c.Host, resp.Status)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response from %s: %w", c.Host, err)
+	}
+	return respBody, nil
+}